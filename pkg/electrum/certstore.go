@@ -0,0 +1,120 @@
+package electrum
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrCertNotFound is returned by a CertStore's Load method when no
+// certificate has been pinned for a host yet.
+var ErrCertNotFound = errors.New("electrum: no pinned certificate for host")
+
+// CertStore persists the DER-encoded leaf certificate electrumrelay has
+// seen for a host, implementing trust-on-first-use pinning for Electrum's
+// largely self-signed TLS certificates.
+type CertStore interface {
+	// Load returns the pinned DER certificate for host, or ErrCertNotFound
+	// if none has been pinned yet.
+	Load(host string) ([]byte, error)
+	// Save pins derCert as the trusted certificate for host.
+	Save(host string, derCert []byte) error
+}
+
+// FileCertStore is the default CertStore, persisting pinned certificates to
+// a single JSON file on disk as host -> base64(DER cert) pairs.
+type FileCertStore struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewFileCertStore creates a FileCertStore backed by the file at path. The
+// file is created on the first Save; it does not need to exist beforehand.
+func NewFileCertStore(path string) *FileCertStore {
+	return &FileCertStore{Path: path}
+}
+
+// Load implements CertStore.
+func (f *FileCertStore) Load(host string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	certs, err := f.readAll()
+	if err != nil {
+		return nil, err
+	}
+	der, ok := certs[host]
+	if !ok {
+		return nil, ErrCertNotFound
+	}
+	return der, nil
+}
+
+// Save implements CertStore.
+func (f *FileCertStore) Save(host string, derCert []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	certs, err := f.readAll()
+	if err != nil {
+		return err
+	}
+	certs[host] = derCert
+	return f.writeAll(certs)
+}
+
+func (f *FileCertStore) readAll() (map[string][]byte, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(map[string][]byte), nil
+		}
+		return nil, fmt.Errorf("could not read cert store %s: %v", f.Path, err)
+	}
+	encoded := make(map[string]string)
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, fmt.Errorf("could not parse cert store %s: %v", f.Path, err)
+	}
+	certs := make(map[string][]byte, len(encoded))
+	for host, b64 := range encoded {
+		der, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode pinned certificate for %s in %s: %v", host, f.Path, err)
+		}
+		certs[host] = der
+	}
+	return certs, nil
+}
+
+func (f *FileCertStore) writeAll(certs map[string][]byte) error {
+	encoded := make(map[string]string, len(certs))
+	for host, der := range certs {
+		encoded[host] = base64.StdEncoding.EncodeToString(der)
+	}
+	data, err := json.MarshalIndent(encoded, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode cert store: %v", err)
+	}
+	if err := os.WriteFile(f.Path, data, 0o600); err != nil {
+		return fmt.Errorf("could not write cert store %s: %v", f.Path, err)
+	}
+	return nil
+}
+
+// ErrCertChanged is returned when a host's certificate no longer matches the
+// one pinned on first contact. On the Electrum network this usually means
+// either the operator rotated an expired cert or a MITM-capable exit node is
+// intercepting the connection.
+type ErrCertChanged struct {
+	Host           string
+	OldFingerprint [32]byte
+	NewFingerprint [32]byte
+}
+
+func (e *ErrCertChanged) Error() string {
+	return fmt.Sprintf("electrum: certificate for %s changed: pinned %x, got %x", e.Host, e.OldFingerprint, e.NewFingerprint)
+}
@@ -0,0 +1,126 @@
+package electrum
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+)
+
+func discardClient() *Client {
+	discard := log.New(io.Discard, "", 0)
+	return NewClient(discard, discard, discard)
+}
+
+func TestFileCertStoreLoadMissing(t *testing.T) {
+	store := NewFileCertStore(filepath.Join(t.TempDir(), "certs.json"))
+
+	if _, err := store.Load("example.com"); !errors.Is(err, ErrCertNotFound) {
+		t.Fatalf("expected ErrCertNotFound, got %v", err)
+	}
+}
+
+func TestFileCertStoreSaveThenLoadRoundTrips(t *testing.T) {
+	store := NewFileCertStore(filepath.Join(t.TempDir(), "certs.json"))
+	want := []byte{0xDE, 0xAD, 0xBE, 0xEF}
+
+	if err := store.Save("example.com", want); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	got, err := store.Load("example.com")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("Load returned %x, want %x", got, want)
+	}
+}
+
+func TestFileCertStorePersistsAcrossInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "certs.json")
+	want := []byte{0x01, 0x02, 0x03}
+
+	if err := NewFileCertStore(path).Save("example.com", want); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	got, err := NewFileCertStore(path).Load("example.com")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("Load returned %x, want %x", got, want)
+	}
+}
+
+func TestVerifyPeerCertificatePinsOnFirstContact(t *testing.T) {
+	c := discardClient()
+	c.CertStore = NewFileCertStore(filepath.Join(t.TempDir(), "certs.json"))
+	verify := c.verifyPeerCertificate("example.com")
+
+	leaf := []byte("first certificate seen")
+	if err := verify([][]byte{leaf}, nil); err != nil {
+		t.Fatalf("expected first contact to succeed, got %v", err)
+	}
+
+	pinned, err := c.CertStore.Load("example.com")
+	if err != nil {
+		t.Fatalf("expected a pinned cert after first contact: %v", err)
+	}
+	if string(pinned) != string(leaf) {
+		t.Fatalf("pinned %x, want %x", pinned, leaf)
+	}
+}
+
+func TestVerifyPeerCertificateAcceptsMatchingCertOnReconnect(t *testing.T) {
+	c := discardClient()
+	c.CertStore = NewFileCertStore(filepath.Join(t.TempDir(), "certs.json"))
+	verify := c.verifyPeerCertificate("example.com")
+	leaf := []byte("pinned certificate")
+
+	if err := verify([][]byte{leaf}, nil); err != nil {
+		t.Fatalf("first contact failed: %v", err)
+	}
+	if err := verify([][]byte{leaf}, nil); err != nil {
+		t.Fatalf("expected matching cert on reconnect to be accepted, got %v", err)
+	}
+}
+
+func TestVerifyPeerCertificateRejectsChangedCert(t *testing.T) {
+	c := discardClient()
+	c.CertStore = NewFileCertStore(filepath.Join(t.TempDir(), "certs.json"))
+	verify := c.verifyPeerCertificate("example.com")
+
+	if err := verify([][]byte{[]byte("original certificate")}, nil); err != nil {
+		t.Fatalf("first contact failed: %v", err)
+	}
+
+	err := verify([][]byte{[]byte("a different certificate")}, nil)
+	var certErr *ErrCertChanged
+	if !errors.As(err, &certErr) {
+		t.Fatalf("expected ErrCertChanged, got %v", err)
+	}
+	if certErr.Host != "example.com" {
+		t.Fatalf("ErrCertChanged.Host = %q, want %q", certErr.Host, "example.com")
+	}
+}
+
+func TestVerifyPeerCertificatePrefersPinnedFingerprintOverCertStore(t *testing.T) {
+	c := discardClient()
+	c.CertStore = NewFileCertStore(filepath.Join(t.TempDir(), "certs.json"))
+	leaf := []byte("certificate matching the out-of-band pin")
+	fp := sha256.Sum256(leaf)
+	c.PinnedFingerprints = map[string][]byte{"example.com": fp[:]}
+
+	verify := c.verifyPeerCertificate("example.com")
+	if err := verify([][]byte{leaf}, nil); err != nil {
+		t.Fatalf("expected cert matching PinnedFingerprints to be accepted, got %v", err)
+	}
+
+	// A CertStore entry should never have been written: PinnedFingerprints
+	// takes priority and bypasses it entirely.
+	if _, err := c.CertStore.Load("example.com"); !errors.Is(err, ErrCertNotFound) {
+		t.Fatalf("expected CertStore to remain untouched, got %v", err)
+	}
+}
@@ -1,8 +1,11 @@
 package electrum
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,11 +14,50 @@ import (
 	"time"
 )
 
+// Dialer opens a connection to addr over network, mirroring the signature of
+// net.Dial. Callers can set Client.dialer via WithDialer to inject their own
+// SOCKS/golang.org/x/net/proxy implementation, e.g. for tests.
+type Dialer func(network, addr string) (net.Conn, error)
+
 // Client handles connecting, sending requests, and the logging thereof to Electrum servers.
 type Client struct {
 	InfoLogger    *log.Logger
 	WarningLogger *log.Logger
 	ErrorLogger   *log.Logger
+
+	// SOCKSProxy is the address (host:port) of a SOCKS5 proxy, typically a
+	// local Tor daemon at 127.0.0.1:9050. When set, onion nodes are always
+	// dialed through it, and clearnet nodes are too since many users torify
+	// everything.
+	SOCKSProxy string
+	// SOCKSAuth supplies optional SOCKS5 username/password credentials used
+	// when dialing through SOCKSProxy. Tor treats distinct credentials as a
+	// request for a fresh circuit. The same credentials are sent for every
+	// node this Client dials.
+	SOCKSAuth *SOCKSAuth
+
+	// CertStore pins Electrum servers' self-signed TLS certificates on
+	// first contact (trust-on-first-use) and rejects any later connection
+	// whose certificate doesn't match. Nil disables trust-on-first-use
+	// pinning; PinnedFingerprints are still enforced.
+	CertStore CertStore
+	// StrictTLS, when true, skips TOFU pinning and requires standard CA
+	// verification instead. Most Electrum servers use self-signed certs, so
+	// this will reject them unless StrictTLS servers are specifically
+	// targeted.
+	StrictTLS bool
+	// PinnedFingerprints lets callers ship known-good sha256 certificate
+	// fingerprints out of band (keyed by host), bypassing CertStore for
+	// those hosts entirely.
+	PinnedFingerprints map[string][]byte
+
+	// MaxLineBytes caps how large a single response line SendRequest,
+	// SendBatch, and SendRequestBytes will buffer before giving up, to
+	// protect against a malicious peer streaming gigabytes before ever
+	// sending a newline. Zero uses defaultMaxLineBytes.
+	MaxLineBytes int
+
+	dialer Dialer
 }
 
 // NewClient creates a new electrum client.
@@ -23,20 +65,43 @@ func NewClient(infoLogger *log.Logger, warningLogger *log.Logger, errorLogger *l
 	return &Client{InfoLogger: infoLogger, WarningLogger: warningLogger, ErrorLogger: errorLogger}
 }
 
+// WithDialer overrides how the client opens the underlying network
+// connection, letting callers inject their own SOCKS/golang.org/x/net/proxy
+// implementation in place of the built-in SOCKS5 dialer. It returns c so
+// callers can chain it off NewClient.
+func (c *Client) WithDialer(d Dialer) *Client {
+	c.dialer = d
+	return c
+}
+
+// dial opens addr, routing through SOCKSProxy (or the custom dialer set via
+// WithDialer) when one is configured, and falling back to a plain TCP dial
+// otherwise.
+func (c *Client) dial(addr string, timeout time.Duration) (net.Conn, error) {
+	if c.dialer != nil {
+		return c.dialer("tcp", addr)
+	}
+	if c.SOCKSProxy != "" {
+		return DialOnion(c.SOCKSProxy, addr, c.SOCKSAuth, timeout)
+	}
+	return net.DialTimeout("tcp", addr, timeout)
+}
+
 // Connect tries to connect to a node in the following order: Tor, TLS, TCP.
 func (c *Client) Connect(n *Node, timeout time.Duration) (net.Conn, error) {
-	if n.IsOnion() {
-		c.ErrorLogger.Printf("failed to connect to %s: tor support not yet implemented\n", n.Host)
-		return nil, errors.New("to support not yet implemented")
+	if n.IsOnion() && c.SOCKSProxy == "" && c.dialer == nil {
+		c.ErrorLogger.Printf("failed to connect to %s: no SOCKS proxy configured for onion node\n", n.Host)
+		return nil, errors.New("no SOCKS proxy configured for onion node")
 	}
 	if n.SupportsTLS() {
 		c.InfoLogger.Printf("%s supports TLS, attempting TLS connection\n", n.Host)
 		conn, err := c.GetTLSConn(n, timeout)
 		if err != nil {
 			c.ErrorLogger.Printf("error establishing TLS connection to: %s\n", n.Host)
-			connErr := conn.Close()
-			if connErr != nil {
-				c.ErrorLogger.Printf("could not close connection to: %s after failed TLS connection attempt: %v\n", n.Host, connErr)
+			if conn != nil {
+				if connErr := conn.Close(); connErr != nil {
+					c.ErrorLogger.Printf("could not close connection to: %s after failed TLS connection attempt: %v\n", n.Host, connErr)
+				}
 			}
 			return nil, err
 		}
@@ -46,114 +111,156 @@ func (c *Client) Connect(n *Node, timeout time.Duration) (net.Conn, error) {
 	c.InfoLogger.Printf("%s supports TCP, attempting TCP connection\n", n.Host)
 	if err != nil {
 		c.ErrorLogger.Printf("error establishing TLS connection to: %s\n: %v", n.Host, err)
-		connErr := conn.Close()
-		if connErr != nil {
-			c.ErrorLogger.Printf("could not close connection to: %s after failed TCP connection attempt: %v\n", n.Host, connErr)
+		if conn != nil {
+			if connErr := conn.Close(); connErr != nil {
+				c.ErrorLogger.Printf("could not close connection to: %s after failed TCP connection attempt: %v\n", n.Host, connErr)
+			}
 		}
 		return nil, err
 	}
 	return conn, nil
 }
 
-// GetTLSConn establishes a TLS connection to a given node.
+// GetTLSConn establishes a TLS connection to a given node, dialing through
+// SOCKSProxy when one is configured (required for onion nodes).
 func (c *Client) GetTLSConn(n *Node, timeout time.Duration) (*tls.Conn, error) {
-	if n.IsOnion() {
-		c.ErrorLogger.Printf("failed to connect to %s: tor support not yet implemented\n", n.Host)
-		return nil, errors.New("tor support not yet implemented")
+	if n.IsOnion() && c.SOCKSProxy == "" && c.dialer == nil {
+		c.ErrorLogger.Printf("failed to connect to %s: no SOCKS proxy configured for onion node\n", n.Host)
+		return nil, errors.New("no SOCKS proxy configured for onion node")
 	}
 	if !n.SupportsTLS() {
 		c.ErrorLogger.Printf("%s does not support TLS, not attempting to connect\n", n.Host)
 		return nil, errors.New("node does not support SSL/TLS")
 	}
+	connStr := fmt.Sprintf("%s:%d", n.Host, n.SSLPort)
+	rawConn, err := c.dial(connStr, timeout)
+	if err != nil {
+		c.ErrorLogger.Printf("error establishing connection to: %s\n: %v", connStr, err)
+		return nil, fmt.Errorf("could not establish TLS connection to %s: %v", connStr, err)
+	}
+	// Electrum servers are almost universally self-signed, so standard CA
+	// verification is skipped by default in favor of trust-on-first-use
+	// pinning via VerifyPeerCertificate. StrictTLS opts back into normal
+	// verification for the rare server with a CA-issued cert.
 	conf := &tls.Config{
-		InsecureSkipVerify: true,
+		InsecureSkipVerify: !c.StrictTLS,
+		ServerName:         n.Host,
 	}
-	dialer := &net.Dialer{
-		Timeout: timeout,
+	if !c.StrictTLS {
+		conf.VerifyPeerCertificate = c.verifyPeerCertificate(n.Host)
 	}
-	connStr := fmt.Sprintf("%s:%d", n.Host, n.SSLPort)
-	conn, err := tls.DialWithDialer(dialer, "tcp", connStr, conf)
-	if err != nil {
+	// timeout bounded only the TCP connect above; it must also bound the
+	// handshake itself, or a peer that accepts the connection and then
+	// sends nothing hangs Handshake forever. Mirrors what DialOnion does
+	// for its own handshake, and what tls.DialWithDialer used to give us
+	// for free.
+	if timeout > 0 {
+		if err := rawConn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			_ = rawConn.Close()
+			return nil, fmt.Errorf("could not set TLS handshake deadline for %s: %v", connStr, err)
+		}
+	}
+	conn := tls.Client(rawConn, conf)
+	if err := conn.Handshake(); err != nil {
+		_ = rawConn.Close()
+		var certErr *ErrCertChanged
+		if errors.As(err, &certErr) {
+			c.ErrorLogger.Printf("certificate for %s changed since it was first pinned: %v\n", connStr, certErr)
+			return nil, certErr
+		}
 		c.ErrorLogger.Printf("error establishing TLS connection to: %s\n: %v", connStr, err)
 		return nil, fmt.Errorf("could not establish TLS connection to %s: %v", connStr, err)
 	}
+	if timeout > 0 {
+		if err := rawConn.SetDeadline(time.Time{}); err != nil {
+			_ = rawConn.Close()
+			return nil, fmt.Errorf("could not clear TLS handshake deadline for %s: %v", connStr, err)
+		}
+	}
 	c.InfoLogger.Printf("successfully established TLS connection to %s\n", connStr)
 	return conn, nil
 }
 
-// GetConn establishes a TCP connection to a given node.
-func (c *Client) GetConn(n *Node, timeout time.Duration) (net.Conn, error) {
-	if n.IsOnion() {
-		c.ErrorLogger.Printf("failed to connect to %s: tor support not yet implemented\n", n.Host)
-		return nil, errors.New("tor support not yet implemented")
-	}
-	connStr := fmt.Sprintf("%s:%d", n.Host, n.TCPPort)
-	c.InfoLogger.Printf("establishing TCP connection to %s\n", connStr)
-	conn, err := net.DialTimeout("tcp", connStr, timeout)
-	if err != nil {
-		c.ErrorLogger.Printf("could not establish TLS connection to %s: %v\n", connStr, err)
-		return nil, fmt.Errorf("could not establish TLS connection to %s: %v", connStr, err)
-	}
-	c.InfoLogger.Printf("successfully established TCP connection to %s\n", connStr)
-	return conn, nil
-}
+// verifyPeerCertificate implements certificate pinning for host. If
+// PinnedFingerprints has an entry for host, the leaf certificate's sha256
+// fingerprint must match it and CertStore is not consulted. Otherwise the
+// first leaf certificate seen is pinned to CertStore (trust-on-first-use),
+// and every later connection must present a byte-identical certificate. A
+// mismatch fails the handshake with ErrCertChanged. With no entry in
+// PinnedFingerprints and a nil CertStore, any certificate is accepted.
+func (c *Client) verifyPeerCertificate(host string) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("electrum: server presented no certificate")
+		}
+		leaf := rawCerts[0]
+		newFp := sha256.Sum256(leaf)
 
-// SendRequest sends a JSON RPC Request to a node, and returns a response as bytes.
-func (c *Client) SendRequest(req *JSONRPCRequest, n *Node, timeout time.Duration) ([]byte, error) {
-	c.InfoLogger.Printf("attempting to connect to %s\n", n.Host)
-	conn, err := c.Connect(n, timeout)
-	if err != nil {
-		return nil, fmt.Errorf("could not connect to %s: %v", n.Host, err)
-	}
-	c.InfoLogger.Printf("sending request ID: %d to: %s\n", req.ID, n.Host)
-	resp, err := req.Send(conn)
-	if err != nil {
-		c.ErrorLogger.Printf("error sending request ID: %d to: %s: %v\n", req.ID, n.Host, err)
-		connErr := conn.Close()
-		if connErr != nil {
-			c.ErrorLogger.Printf("could not close connection to: %s after failed request ID: %d: %v\n", n.Host, req.ID, connErr)
+		if pinned, ok := c.PinnedFingerprints[host]; ok {
+			if !bytes.Equal(pinned, newFp[:]) {
+				var oldFp [32]byte
+				copy(oldFp[:], pinned)
+				return &ErrCertChanged{Host: host, OldFingerprint: oldFp, NewFingerprint: newFp}
+			}
+			return nil
 		}
-		return nil, err
+
+		if c.CertStore == nil {
+			return nil
+		}
+		existing, err := c.CertStore.Load(host)
+		if err != nil {
+			if errors.Is(err, ErrCertNotFound) {
+				if err := c.CertStore.Save(host, leaf); err != nil {
+					return fmt.Errorf("electrum: could not pin certificate for %s: %v", host, err)
+				}
+				return nil
+			}
+			return fmt.Errorf("electrum: could not load pinned certificate for %s: %v", host, err)
+		}
+		if !bytes.Equal(existing, leaf) {
+			return &ErrCertChanged{Host: host, OldFingerprint: sha256.Sum256(existing), NewFingerprint: newFp}
+		}
+		return nil
 	}
-	_ = conn.Close()
-	return resp, nil
 }
 
-func (c *Client) SendRequestBytes(req []byte, n *Node, timeout time.Duration) ([]byte, error) {
-	c.InfoLogger.Printf("attempting to connect to %s\n", n.Host)
-	conn, err := c.Connect(n, timeout)
-	if err != nil {
-		return nil, err
-	}
-	c.InfoLogger.Printf("sending request: %s to: %s\n", string(req), n.Host)
-	fmt.Println(conn)
-	_, err = fmt.Fprintf(conn, "%s", string(req)+"\n")
-	if err != nil {
-		return nil, err
+// GetConn establishes a TCP connection to a given node, dialing through
+// SOCKSProxy when one is configured (required for onion nodes).
+func (c *Client) GetConn(n *Node, timeout time.Duration) (net.Conn, error) {
+	if n.IsOnion() && c.SOCKSProxy == "" && c.dialer == nil {
+		c.ErrorLogger.Printf("failed to connect to %s: no SOCKS proxy configured for onion node\n", n.Host)
+		return nil, errors.New("no SOCKS proxy configured for onion node")
 	}
-	resp, _ := bufio.NewReader(conn).ReadBytes(byte('\n'))
-	fmt.Println(string(resp))
+	connStr := fmt.Sprintf("%s:%d", n.Host, n.TCPPort)
+	c.InfoLogger.Printf("establishing TCP connection to %s\n", connStr)
+	conn, err := c.dial(connStr, timeout)
 	if err != nil {
-		return nil, err
+		c.ErrorLogger.Printf("could not establish TCP connection to %s: %v\n", connStr, err)
+		return nil, fmt.Errorf("could not establish TCP connection to %s: %v", connStr, err)
 	}
-	_ = conn.Close()
-	return resp, nil
+	c.InfoLogger.Printf("successfully established TCP connection to %s\n", connStr)
+	return conn, nil
 }
 
 // GetPeerInfo gets peer information from a node by sending it a server.peers.subscribe JSON RPC Request
 // It then parses the response and returns a []Node of Electrum peers.
-func (c *Client) GetPeerInfo(n *Node, reqID int, timeout time.Duration) ([]Node, error) {
-	if n.IsOnion() {
-		c.ErrorLogger.Printf("failed to connect to %s: tor support not yet implemented\n", n.Host)
-		return nil, errors.New("tor support not yet implemented")
+func (c *Client) GetPeerInfo(ctx context.Context, n *Node, reqID int, timeout time.Duration) ([]Node, error) {
+	if n.IsOnion() && c.SOCKSProxy == "" && c.dialer == nil {
+		c.ErrorLogger.Printf("failed to connect to %s: no SOCKS proxy configured for onion node\n", n.Host)
+		return nil, errors.New("no SOCKS proxy configured for onion node")
 	}
-	resp, err := c.SendRequest(NewPeerRequest(reqID), n, timeout)
+	resp, err := c.SendRequest(ctx, NewPeerRequest(reqID), n, timeout)
 	if err != nil {
 		c.ErrorLogger.Printf("failed to send peer request ID %d to %s: %v\n", reqID, n.Host, err)
 		return nil, err
 	}
+	if resp.Error != nil {
+		c.ErrorLogger.Printf("peer request ID %d to %s returned an rpc error: %v\n", reqID, n.Host, resp.Error)
+		return nil, resp.Error
+	}
 	spr := new(ServerPeersSubscriptionResp)
-	err = json.Unmarshal(resp, spr)
+	err = json.Unmarshal(resp.Result, spr)
 	if err != nil {
 		c.ErrorLogger.Printf("error unmarshalling server peer subscription from %s req ID %d: %v\n", n.Host, reqID, err)
 		return nil, err
@@ -0,0 +1,189 @@
+package electrum
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// defaultMaxLineBytes is used in place of Client.MaxLineBytes when it's left
+// at its zero value.
+const defaultMaxLineBytes = 1 << 20 // 1MiB
+
+// SendRequest sends a single JSON-RPC request to n over a fresh connection
+// and returns its decoded response. timeout bounds the dial; ctx bounds the
+// write and the read: its deadline (if any) is applied to the socket and its
+// cancellation aborts an in-flight write or read.
+func (c *Client) SendRequest(ctx context.Context, req *JSONRPCRequest, n *Node, timeout time.Duration) (*JSONRPCResponse, error) {
+	resps, err := c.SendBatch(ctx, []JSONRPCRequest{*req}, n, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if len(resps) != 1 {
+		return nil, fmt.Errorf("node %s returned %d responses for 1 request", n.Host, len(resps))
+	}
+	return &resps[0], nil
+}
+
+// SendBatch sends a JSON-RPC 2.0 batch (a JSON array of requests) to n in a
+// single connection and returns the decoded responses in the same order as
+// reqs, matched to their requests by ID whatever order the node replied in.
+func (c *Client) SendBatch(ctx context.Context, reqs []JSONRPCRequest, n *Node, timeout time.Duration) ([]JSONRPCResponse, error) {
+	if len(reqs) == 0 {
+		return nil, errors.New("electrum: SendBatch requires at least one request")
+	}
+
+	c.InfoLogger.Printf("attempting to connect to %s\n", n.Host)
+	conn, err := c.Connect(n, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %v", n.Host, err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	var payload interface{} = reqs
+	if len(reqs) == 1 {
+		payload = reqs[0]
+	}
+	line, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode request to %s: %v", n.Host, err)
+	}
+
+	raw, err := c.roundTrip(ctx, conn, n, line)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reqs) == 1 {
+		var resp JSONRPCResponse
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			return nil, fmt.Errorf("could not decode response from %s: %v", n.Host, err)
+		}
+		return []JSONRPCResponse{resp}, nil
+	}
+	var unordered []JSONRPCResponse
+	if err := json.Unmarshal(raw, &unordered); err != nil {
+		return nil, fmt.Errorf("could not decode batch response from %s: %v", n.Host, err)
+	}
+	return matchBatchResponses(reqs, unordered, n)
+}
+
+// matchBatchResponses maps each response in unordered back to its request
+// by ID and returns them in the same order as reqs, rather than trusting
+// the node to reply in request order. It errors if a response's ID doesn't
+// correspond to exactly one of reqs.
+func matchBatchResponses(reqs []JSONRPCRequest, unordered []JSONRPCResponse, n *Node) ([]JSONRPCResponse, error) {
+	byID := make(map[int]JSONRPCResponse, len(unordered))
+	for _, resp := range unordered {
+		if _, dup := byID[resp.ID]; dup {
+			return nil, fmt.Errorf("batch response from %s contained duplicate ID %d", n.Host, resp.ID)
+		}
+		byID[resp.ID] = resp
+	}
+
+	ordered := make([]JSONRPCResponse, len(reqs))
+	requested := make(map[int]bool, len(reqs))
+	for i, req := range reqs {
+		resp, ok := byID[req.ID]
+		if !ok {
+			return nil, fmt.Errorf("batch response from %s was missing a response for request ID %d", n.Host, req.ID)
+		}
+		ordered[i] = resp
+		requested[req.ID] = true
+	}
+	for id := range byID {
+		if !requested[id] {
+			return nil, fmt.Errorf("batch response from %s contained a response for unrequested ID %d", n.Host, id)
+		}
+	}
+	return ordered, nil
+}
+
+// SendRequestBytes sends a pre-encoded JSON-RPC request (or batch) to n and
+// returns the raw response line. Prefer SendRequest/SendBatch when possible;
+// this exists for callers that already hold wire bytes to send verbatim.
+func (c *Client) SendRequestBytes(ctx context.Context, req []byte, n *Node, timeout time.Duration) ([]byte, error) {
+	c.InfoLogger.Printf("attempting to connect to %s\n", n.Host)
+	conn, err := c.Connect(n, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %v", n.Host, err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	c.InfoLogger.Printf("sending request: %s to: %s\n", string(req), n.Host)
+	return c.roundTrip(ctx, conn, n, req)
+}
+
+// roundTrip writes line to conn and reads back a single '\n'-terminated
+// response, applying ctx's deadline to the socket and aborting early if ctx
+// is cancelled mid-write or mid-read. The response is capped at
+// Client.MaxLineBytes (or defaultMaxLineBytes if unset) to protect against a
+// peer streaming unbounded data before ever sending a newline.
+func (c *Client) roundTrip(ctx context.Context, conn net.Conn, n *Node, line []byte) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, fmt.Errorf("could not set deadline for %s: %v", n.Host, err)
+		}
+	}
+
+	writeDone := make(chan error, 1)
+	go func() {
+		// Copy into a fresh buffer before appending the delimiter: line may
+		// be a caller-owned slice with spare capacity, and appending to it
+		// in place could silently overwrite memory the caller still holds.
+		delimited := append(append([]byte(nil), line...), '\n')
+		_, err := conn.Write(delimited)
+		writeDone <- err
+	}()
+	select {
+	case err := <-writeDone:
+		if err != nil {
+			return nil, fmt.Errorf("could not send request to %s: %v", n.Host, err)
+		}
+	case <-ctx.Done():
+		_ = conn.Close()
+		return nil, ctx.Err()
+	}
+
+	maxBytes := c.MaxLineBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxLineBytes
+	}
+	type readResult struct {
+		data []byte
+		err  error
+	}
+	readDone := make(chan readResult, 1)
+	go func() {
+		data, err := readLimitedLine(conn, maxBytes)
+		readDone <- readResult{data, err}
+	}()
+	select {
+	case r := <-readDone:
+		if r.err != nil {
+			return nil, fmt.Errorf("could not read response from %s: %v", n.Host, r.err)
+		}
+		return r.data, nil
+	case <-ctx.Done():
+		_ = conn.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// readLimitedLine reads a single '\n'-terminated line from conn, refusing to
+// buffer more than maxBytes.
+func readLimitedLine(conn net.Conn, maxBytes int) ([]byte, error) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxBytes)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("connection closed before a full response line was read")
+	}
+	return scanner.Bytes(), nil
+}
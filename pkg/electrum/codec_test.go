@@ -0,0 +1,64 @@
+package electrum
+
+import "testing"
+
+func TestMatchBatchResponses(t *testing.T) {
+	reqs := []JSONRPCRequest{{ID: 1}, {ID: 2}, {ID: 3}}
+	n := &Node{Host: "test"}
+
+	cases := []struct {
+		name      string
+		unordered []JSONRPCResponse
+		wantErr   bool
+		wantOrder []int
+	}{
+		{
+			name:      "already in request order",
+			unordered: []JSONRPCResponse{{ID: 1}, {ID: 2}, {ID: 3}},
+			wantOrder: []int{1, 2, 3},
+		},
+		{
+			name:      "server replied out of order",
+			unordered: []JSONRPCResponse{{ID: 3}, {ID: 1}, {ID: 2}},
+			wantOrder: []int{1, 2, 3},
+		},
+		{
+			name:      "missing a response",
+			unordered: []JSONRPCResponse{{ID: 1}, {ID: 2}},
+			wantErr:   true,
+		},
+		{
+			name:      "duplicate response ID",
+			unordered: []JSONRPCResponse{{ID: 1}, {ID: 1}, {ID: 2}, {ID: 3}},
+			wantErr:   true,
+		},
+		{
+			name:      "response ID not in the request set",
+			unordered: []JSONRPCResponse{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 99}},
+			wantErr:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ordered, err := matchBatchResponses(reqs, tc.unordered, n)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(ordered) != len(tc.wantOrder) {
+				t.Fatalf("got %d responses, want %d", len(ordered), len(tc.wantOrder))
+			}
+			for i, id := range tc.wantOrder {
+				if ordered[i].ID != id {
+					t.Fatalf("response %d has ID %d, want %d", i, ordered[i].ID, id)
+				}
+			}
+		})
+	}
+}
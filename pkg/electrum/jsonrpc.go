@@ -0,0 +1,38 @@
+package electrum
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// JSONRPCError is the typed form of a JSON-RPC 2.0 error object, returned by
+// a node in place of a result when it can't service a request.
+type JSONRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface.
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// Is lets errors.Is match two JSONRPCErrors with the same Code, so callers
+// can write errors.Is(err, &JSONRPCError{Code: someCode}) without caring
+// about Message.
+func (e *JSONRPCError) Is(target error) bool {
+	var other *JSONRPCError
+	if !errors.As(target, &other) {
+		return false
+	}
+	return e.Code == other.Code
+}
+
+// JSONRPCResponse is a single decoded JSON-RPC 2.0 response line: Result is
+// set on success, Error is set on failure, and they are never both non-nil.
+type JSONRPCResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *JSONRPCError   `json:"error"`
+}
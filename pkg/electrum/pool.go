@@ -0,0 +1,129 @@
+package electrum
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Pool holds one long-lived Session per Node so callers don't pay a fresh
+// TLS handshake (and, for onion nodes, a fresh SOCKS5 circuit) on every
+// request. Sessions are created lazily and replaced if they're found
+// unhealthy.
+type Pool struct {
+	client  *Client
+	timeout time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+	known    map[string]*Node
+}
+
+// NewPool creates a Pool that dials Sessions via c, applying timeout to each
+// dial and to the keepalive pings and resubscribe calls its Sessions send on
+// their own. A Session.Call is bounded only by its caller's ctx.
+func NewPool(c *Client, timeout time.Duration) *Pool {
+	return &Pool{client: c, timeout: timeout, sessions: make(map[string]*Session), known: make(map[string]*Node)}
+}
+
+// Add seeds the Pool with known peers, e.g. the result of a prior
+// Client.GetPeerInfo crawl, so PickHealthy has candidates to dial.
+func (p *Pool) Add(nodes ...*Node) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, n := range nodes {
+		if _, ok := p.known[n.Host]; !ok {
+			p.known[n.Host] = n
+		}
+	}
+}
+
+// PickHealthy returns a Session to any currently healthy peer, dialing a
+// known-but-unconnected peer if none is already up. It's how Server picks
+// an upstream to forward an inbound request to.
+func (p *Pool) PickHealthy() (*Session, error) {
+	p.mu.Lock()
+	for _, s := range p.sessions {
+		if s.Healthy() {
+			p.mu.Unlock()
+			return s, nil
+		}
+	}
+	var candidates []*Node
+	for host, n := range p.known {
+		if _, ok := p.sessions[host]; !ok {
+			candidates = append(candidates, n)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, n := range candidates {
+		if s, err := p.Get(n); err == nil {
+			return s, nil
+		}
+	}
+	return nil, errors.New("pool: no healthy peers available")
+}
+
+// Get returns a healthy Session for n, reusing one from the pool when
+// possible and dialing a new one otherwise. The dial itself runs without
+// p.mu held, so one slow or stalling peer can't freeze every other caller's
+// Get/PickHealthy/Healthy for the lifetime of the Pool.
+func (p *Pool) Get(n *Node) (*Session, error) {
+	p.mu.Lock()
+	if s, ok := p.sessions[n.Host]; ok {
+		if s.Healthy() {
+			p.mu.Unlock()
+			return s, nil
+		}
+		_ = s.Close()
+		delete(p.sessions, n.Host)
+	}
+	p.mu.Unlock()
+
+	s, err := NewSession(p.client, n, p.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("pool: could not start session with %s: %v", n.Host, err)
+	}
+
+	p.mu.Lock()
+	if existing, ok := p.sessions[n.Host]; ok && existing.Healthy() {
+		p.mu.Unlock()
+		_ = s.Close()
+		return existing, nil
+	}
+	p.sessions[n.Host] = s
+	p.mu.Unlock()
+	return s, nil
+}
+
+// Healthy returns the hosts of every Session currently tracked as healthy.
+func (p *Pool) Healthy() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hosts := make([]string, 0, len(p.sessions))
+	for host, s := range p.sessions {
+		if s.Healthy() {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// Close closes every Session held by the Pool.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var firstErr error
+	for host, s := range p.sessions {
+		if err := s.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("could not close session to %s: %v", host, err)
+		}
+		delete(p.sessions, host)
+	}
+	return firstErr
+}
@@ -0,0 +1,72 @@
+package electrum
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestPoolGetDoesNotBlockHealthyDuringSlowDial reproduces the deadlock a
+// Get that held p.mu across its dial used to cause: a single slow or
+// stalling peer must not freeze every other concurrent Get/Healthy call for
+// the Pool's whole lifetime.
+func TestPoolGetDoesNotBlockHealthyDuringSlowDial(t *testing.T) {
+	dialStarted := make(chan struct{})
+	releaseDial := make(chan struct{})
+	c := discardClient().WithDialer(func(_, _ string) (net.Conn, error) {
+		close(dialStarted)
+		<-releaseDial
+		client, _ := net.Pipe()
+		return client, nil
+	})
+	pool := NewPool(c, time.Second)
+	defer pool.Close()
+
+	getDone := make(chan error, 1)
+	go func() {
+		_, err := pool.Get(&Node{Host: "slow"})
+		getDone <- err
+	}()
+
+	select {
+	case <-dialStarted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Get never reached the dial")
+	}
+
+	healthyDone := make(chan []string, 1)
+	go func() {
+		healthyDone <- pool.Healthy()
+	}()
+
+	select {
+	case <-healthyDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Healthy() blocked behind a concurrent Get's in-flight dial")
+	}
+
+	close(releaseDial)
+	if err := <-getDone; err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+}
+
+func TestPoolGetReusesHealthySession(t *testing.T) {
+	conns := make(chan net.Conn, 4)
+	c := discardClient().WithDialer(pipeDialer(conns))
+	pool := NewPool(c, time.Second)
+	defer pool.Close()
+
+	n := &Node{Host: "test"}
+	first, err := pool.Get(n)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	second, err := pool.Get(n)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if first != second {
+		t.Fatal("expected a second Get for the same healthy node to reuse the existing Session")
+	}
+}
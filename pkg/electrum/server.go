@@ -0,0 +1,208 @@
+package electrum
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxServerLineBytes bounds a single inbound request line. It's raised well
+// past bufio.Scanner's 64KiB default since blockchain.transaction.get
+// responses relayed back through a caching Handler can be close to 1MiB.
+const maxServerLineBytes = 1 << 20
+
+// Handler lets a Server answer inbound Electrum requests itself instead of
+// forwarding them upstream, e.g. to answer server.version locally, cache
+// blockchain.headers.subscribe, or rate-limit by client IP.
+type Handler interface {
+	ServeElectrum(ctx context.Context, clientAddr net.Addr, req *JSONRPCRequest) (json.RawMessage, error)
+}
+
+// HandlerFunc adapts a plain function to Handler.
+type HandlerFunc func(ctx context.Context, clientAddr net.Addr, req *JSONRPCRequest) (json.RawMessage, error)
+
+// ServeElectrum implements Handler.
+func (f HandlerFunc) ServeElectrum(ctx context.Context, clientAddr net.Addr, req *JSONRPCRequest) (json.RawMessage, error) {
+	return f(ctx, clientAddr, req)
+}
+
+// Server accepts inbound Electrum JSON-RPC clients and relays their
+// requests to a healthy upstream peer picked from Pool, or hands every
+// request to Handler instead when one is set. It's modeled on the same
+// listeners+WaitGroup+done-channel shape used elsewhere for long-running
+// network servers.
+type Server struct {
+	// Pool supplies the upstream peer a request is forwarded to when
+	// Handler is nil.
+	Pool *Pool
+	// Handler, if set, answers every inbound request; the Server then
+	// forwards nothing to Pool itself.
+	Handler Handler
+	// ReadTimeout bounds how long a client connection may sit idle between
+	// requests before it's closed. Zero disables the deadline.
+	ReadTimeout time.Duration
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	wg        sync.WaitGroup
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewServer creates a Server relaying requests through pool.
+func NewServer(pool *Pool) *Server {
+	return &Server{Pool: pool, ReadTimeout: 30 * time.Second, done: make(chan struct{})}
+}
+
+// ListenTCP starts accepting plaintext Electrum clients on addr.
+func (s *Server) ListenTCP(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("server: could not listen on %s: %v", addr, err)
+	}
+	s.serve(ln)
+	return nil
+}
+
+// ListenTLS starts accepting TLS-wrapped Electrum clients on addr using
+// conf.
+func (s *Server) ListenTLS(addr string, conf *tls.Config) error {
+	ln, err := tls.Listen("tcp", addr, conf)
+	if err != nil {
+		return fmt.Errorf("server: could not listen on %s: %v", addr, err)
+	}
+	s.serve(ln)
+	return nil
+}
+
+func (s *Server) serve(ln net.Listener) {
+	s.mu.Lock()
+	s.listeners = append(s.listeners, ln)
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.handleConn(conn)
+			}()
+		}
+	}()
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxServerLineBytes)
+	for {
+		if s.ReadTimeout > 0 {
+			if err := conn.SetReadDeadline(time.Now().Add(s.ReadTimeout)); err != nil {
+				return
+			}
+		}
+		if !scanner.Scan() {
+			return
+		}
+		s.handleLine(conn, scanner.Bytes())
+	}
+}
+
+func (s *Server) handleLine(conn net.Conn, line []byte) {
+	req := new(JSONRPCRequest)
+	if err := json.Unmarshal(line, req); err != nil {
+		s.writeError(conn, 0, fmt.Errorf("could not parse request: %v", err))
+		return
+	}
+
+	ctx := context.Background()
+	if s.ReadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.ReadTimeout)
+		defer cancel()
+	}
+
+	result, err := s.serveElectrum(ctx, conn.RemoteAddr(), req)
+	if err != nil {
+		s.writeError(conn, req.ID, err)
+		return
+	}
+	s.writeResult(conn, req.ID, result)
+}
+
+func (s *Server) serveElectrum(ctx context.Context, addr net.Addr, req *JSONRPCRequest) (json.RawMessage, error) {
+	if s.Handler != nil {
+		return s.Handler.ServeElectrum(ctx, addr, req)
+	}
+	return s.forward(ctx, req)
+}
+
+func (s *Server) forward(ctx context.Context, req *JSONRPCRequest) (json.RawMessage, error) {
+	peer, err := s.Pool.PickHealthy()
+	if err != nil {
+		return nil, fmt.Errorf("no healthy upstream peer available: %v", err)
+	}
+	return peer.Call(ctx, req.Method, req.Params)
+}
+
+func (s *Server) writeResult(conn net.Conn, id int, result json.RawMessage) {
+	s.writeLine(conn, JSONRPCResponse{ID: id, Result: result})
+}
+
+func (s *Server) writeError(conn net.Conn, id int, err error) {
+	var rpcErr *JSONRPCError
+	if !errors.As(err, &rpcErr) {
+		rpcErr = &JSONRPCError{Code: -32603, Message: err.Error()}
+	}
+	s.writeLine(conn, JSONRPCResponse{ID: id, Error: rpcErr})
+}
+
+func (s *Server) writeLine(conn net.Conn, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	_, _ = conn.Write(append(data, '\n'))
+}
+
+// Shutdown closes every listener, so no new connections are accepted, and
+// waits for every accepted client connection to end before returning, or
+// returns ctx's error if it's done first. It does not close client
+// connections itself: one ends when its client disconnects or when
+// ReadTimeout passes without a new request (never, if ReadTimeout is zero).
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		for _, ln := range s.listeners {
+			_ = ln.Close()
+		}
+		s.mu.Unlock()
+	})
+
+	drained := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,71 @@
+package electrum
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestServerForwardsToHealthyPeer drives a Server end-to-end over real TCP:
+// a client connects, sends a request line, and the Server should forward it
+// through Pool to a (faked) upstream peer and relay the decoded response
+// back to the client verbatim.
+func TestServerForwardsToHealthyPeer(t *testing.T) {
+	conns := make(chan net.Conn, 4)
+	c := discardClient().WithDialer(pipeDialer(conns))
+	pool := NewPool(c, time.Second)
+	defer pool.Close()
+	pool.Add(&Node{Host: "upstream"})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not start listener: %v", err)
+	}
+	defer ln.Close()
+
+	srv := NewServer(pool)
+	srv.serve(ln)
+	defer srv.Shutdown(context.Background())
+
+	errs := make(chan error, 1)
+	go func() {
+		upstream := <-conns
+		defer upstream.Close()
+		req, err := readRequestLine(upstream)
+		if err != nil {
+			errs <- err
+			return
+		}
+		if req.Method != "server.version" {
+			errs <- fmt.Errorf("forwarded request method %q, want server.version", req.Method)
+			return
+		}
+		_, err = fmt.Fprintf(upstream, `{"id":%d,"result":"electrumrelay/1.0"}`+"\n", req.ID)
+		errs <- err
+	}()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial server: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := fmt.Fprint(client, `{"id":1,"method":"server.version","params":[]}`+"\n"); err != nil {
+		t.Fatalf("could not write request: %v", err)
+	}
+
+	line, err := bufio.NewReader(client).ReadString('\n')
+	if err != nil {
+		t.Fatalf("could not read response: %v", err)
+	}
+	want := `{"id":1,"result":"electrumrelay/1.0","error":null}` + "\n"
+	if line != want {
+		t.Fatalf("got response %q, want %q", line, want)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("fake upstream peer failed: %v", err)
+	}
+}
@@ -0,0 +1,383 @@
+package electrum
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pingInterval is how long a Session may sit idle before it sends a
+// server.ping keepalive.
+const pingInterval = 2 * time.Minute
+
+// reconnectBaseDelay and reconnectMaxDelay bound the exponential backoff a
+// Session applies between reconnect attempts after a read error.
+const (
+	reconnectBaseDelay = 500 * time.Millisecond
+	reconnectMaxDelay  = 30 * time.Second
+)
+
+// Notification is an asynchronous, id-less JSON-RPC message pushed by a
+// node after a Subscribe call, e.g. a new block header or a scripthash
+// status change.
+type Notification struct {
+	Method string
+	Params json.RawMessage
+}
+
+// rpcEnvelope is used to sniff an incoming line before deciding whether it's
+// a response (has "id") or a notification (has "method", no "id").
+type rpcEnvelope struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *JSONRPCError   `json:"error"`
+}
+
+// sessionRequest is the wire shape of a request sent over a Session. Session
+// talks JSON-RPC directly instead of going through JSONRPCRequest.Send,
+// since that method owns both writing the request and reading its one
+// response, which can't be shared with Session's single reader goroutine.
+type sessionRequest struct {
+	ID     int         `json:"id"`
+	Method string      `json:"method"`
+	Params interface{} `json:"params"`
+}
+
+type pendingCall struct {
+	result chan json.RawMessage
+	err    chan error
+}
+
+// subscription tracks a live Subscribe call so it can be replayed against a
+// new connection after a reconnect: the upstream node has no memory of
+// subscriptions registered on a connection it just lost.
+type subscription struct {
+	method string
+	params interface{}
+	ch     chan Notification
+}
+
+// Session owns a persistent connection to a single Node and demultiplexes
+// JSON-RPC traffic read from it: responses are matched back to the Call
+// that sent them by id, and notifications are fanned out to subscribers by
+// method and leading param (see subscriptionKey). It reconnects with backoff on read errors and sends
+// a server.ping keepalive when idle.
+type Session struct {
+	client  *Client
+	node    *Node
+	timeout time.Duration
+
+	mu      sync.Mutex
+	conn    net.Conn
+	pending map[int]*pendingCall
+	subs    map[string]*subscription
+	healthy atomic.Bool
+	closed  atomic.Bool
+
+	nextID    int64
+	lastUsed  atomic.Int64
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSession dials node and starts the background reader and keepalive
+// goroutines. The returned Session is safe for concurrent use.
+func NewSession(c *Client, n *Node, timeout time.Duration) (*Session, error) {
+	conn, err := c.Connect(n, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not start session with %s: %v", n.Host, err)
+	}
+	s := &Session{
+		client:  c,
+		node:    n,
+		timeout: timeout,
+		conn:    conn,
+		pending: make(map[int]*pendingCall),
+		subs:    make(map[string]*subscription),
+		done:    make(chan struct{}),
+	}
+	s.healthy.Store(true)
+	s.touch()
+	go s.readLoop()
+	go s.keepaliveLoop()
+	return s, nil
+}
+
+// Healthy reports whether the Session currently believes its connection is
+// usable.
+func (s *Session) Healthy() bool {
+	return s.healthy.Load() && !s.closed.Load()
+}
+
+// Close stops the Session's background goroutines and closes its
+// connection. Pending calls are failed with an error.
+func (s *Session) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.closed.Store(true)
+		close(s.done)
+		s.mu.Lock()
+		conn := s.conn
+		s.failAllLocked(fmt.Errorf("session to %s closed", s.node.Host))
+		s.mu.Unlock()
+		if conn != nil {
+			err = conn.Close()
+		}
+	})
+	return err
+}
+
+// Call sends a single JSON-RPC request and blocks until its response
+// arrives, ctx is cancelled, or the Session is closed.
+func (s *Session) Call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	id := int(atomic.AddInt64(&s.nextID, 1))
+	req := sessionRequest{ID: id, Method: method, Params: params}
+
+	call := &pendingCall{result: make(chan json.RawMessage, 1), err: make(chan error, 1)}
+	s.mu.Lock()
+	if s.closed.Load() {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("session to %s is closed", s.node.Host)
+	}
+	s.pending[id] = call
+	conn := s.conn
+	s.mu.Unlock()
+	s.touch()
+
+	line, err := json.Marshal(req)
+	if err != nil {
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+		return nil, fmt.Errorf("could not encode request ID %d to %s: %v", id, s.node.Host, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetWriteDeadline(deadline)
+	}
+	if _, err := conn.Write(append(line, '\n')); err != nil {
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+		return nil, fmt.Errorf("could not send request ID %d to %s: %v", id, s.node.Host, err)
+	}
+
+	select {
+	case res := <-call.result:
+		return res, nil
+	case err := <-call.err:
+		return nil, err
+	case <-ctx.Done():
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+		return nil, ctx.Err()
+	case <-s.done:
+		return nil, fmt.Errorf("session to %s closed while awaiting request ID %d", s.node.Host, id)
+	}
+}
+
+// Subscribe issues method with params, returning both the synchronous
+// result of the subscribe call itself (e.g. the current tip header for
+// blockchain.headers.subscribe, or the current status for
+// blockchain.scripthash.subscribe — the caller's only way to learn the
+// current state) and a channel of subsequent notifications the node pushes
+// for that subscription.
+func (s *Session) Subscribe(ctx context.Context, method string, params interface{}) (json.RawMessage, <-chan Notification, error) {
+	initial, err := s.Call(ctx, method, params)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not subscribe to %s on %s: %v", method, s.node.Host, err)
+	}
+	ch := make(chan Notification, 8)
+	s.mu.Lock()
+	s.subs[subscriptionKey(method, params)] = &subscription{method: method, params: params, ch: ch}
+	s.mu.Unlock()
+	return initial, ch, nil
+}
+
+// subscriptionKey derives the key under which a subscription's notification
+// channel is stored. Electrum notifications for scripthash-style
+// subscriptions echo the same leading identifying param the subscribe call
+// used (e.g. the scripthash) followed by fresh, ever-changing state (e.g.
+// the new status), so only the leading param is used for correlation, not
+// the full params array. Headers/mempool-style subscriptions carry no such
+// identifying param, so they're keyed by method alone.
+func subscriptionKey(method string, params interface{}) string {
+	id := leadingParam(params)
+	if id == "" {
+		return method
+	}
+	return method + ":" + id
+}
+
+// leadingParam returns the JSON encoding of the first element of params, or
+// "" if params has no elements (or isn't a JSON array).
+func leadingParam(params interface{}) string {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+	var arr []json.RawMessage
+	if err := json.Unmarshal(encoded, &arr); err != nil || len(arr) == 0 {
+		return ""
+	}
+	return string(arr[0])
+}
+
+func (s *Session) touch() {
+	s.lastUsed.Store(time.Now().UnixNano())
+}
+
+// readLoop demultiplexes every line read from the connection: lines with an
+// "id" complete a pending Call, lines with a "method" and no "id" are
+// dispatched as Notifications. It reconnects with backoff on read errors.
+func (s *Session) readLoop() {
+	for {
+		scanner := bufio.NewScanner(s.conn)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			s.dispatch(scanner.Bytes())
+		}
+		if s.closed.Load() {
+			return
+		}
+		s.healthy.Store(false)
+		s.mu.Lock()
+		s.failAllLocked(fmt.Errorf("lost connection to %s", s.node.Host))
+		s.mu.Unlock()
+		if !s.reconnect() {
+			return
+		}
+	}
+}
+
+func (s *Session) dispatch(line []byte) {
+	var env rpcEnvelope
+	if err := json.Unmarshal(line, &env); err != nil {
+		s.client.WarningLogger.Printf("session %s: could not decode line: %v\n", s.node.Host, err)
+		return
+	}
+	if env.ID != nil {
+		s.mu.Lock()
+		call, ok := s.pending[*env.ID]
+		if ok {
+			delete(s.pending, *env.ID)
+		}
+		s.mu.Unlock()
+		if !ok {
+			return
+		}
+		if env.Error != nil {
+			call.err <- env.Error
+			return
+		}
+		call.result <- env.Result
+		return
+	}
+	if env.Method == "" {
+		return
+	}
+	s.mu.Lock()
+	sub, ok := s.subs[subscriptionKey(env.Method, env.Params)]
+	if !ok {
+		sub, ok = s.subs[env.Method]
+	}
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case sub.ch <- Notification{Method: env.Method, Params: env.Params}:
+	default:
+		s.client.WarningLogger.Printf("session %s: dropped notification for %s, subscriber channel full\n", s.node.Host, env.Method)
+	}
+}
+
+func (s *Session) failAllLocked(err error) {
+	for id, call := range s.pending {
+		call.err <- err
+		delete(s.pending, id)
+	}
+}
+
+// reconnect redials the Session's node with exponential backoff, giving up
+// only once the Session has been closed. It returns false if the Session
+// was closed during the attempt.
+func (s *Session) reconnect() bool {
+	delay := reconnectBaseDelay
+	for {
+		select {
+		case <-s.done:
+			return false
+		case <-time.After(delay):
+		}
+		conn, err := s.client.Connect(s.node, s.timeout)
+		if err != nil {
+			s.client.WarningLogger.Printf("session %s: reconnect attempt failed: %v\n", s.node.Host, err)
+			delay *= 2
+			if delay > reconnectMaxDelay {
+				delay = reconnectMaxDelay
+			}
+			continue
+		}
+		s.mu.Lock()
+		s.conn = conn
+		s.mu.Unlock()
+		s.healthy.Store(true)
+		s.client.InfoLogger.Printf("session %s: reconnected\n", s.node.Host)
+		go s.resubscribeAll()
+		return true
+	}
+}
+
+// resubscribeAll replays every live subscription against the Session's new
+// connection: the node behind it has no memory of subscriptions registered
+// on the connection that was just lost, so without this every Notification
+// channel would go silently dark after the first reconnect. It runs in its
+// own goroutine since each replayed Call blocks on a response that only
+// readLoop's resumed scanning can deliver.
+func (s *Session) resubscribeAll() {
+	s.mu.Lock()
+	subs := make([]*subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		subs = append(subs, sub)
+	}
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		_, err := s.Call(ctx, sub.method, sub.params)
+		cancel()
+		if err != nil {
+			s.client.WarningLogger.Printf("session %s: could not resubscribe to %s: %v\n", s.node.Host, sub.method, err)
+		}
+	}
+}
+
+// keepaliveLoop sends a server.ping after the Session has been idle for
+// pingInterval, so nodes don't close the connection out from under us.
+func (s *Session) keepaliveLoop() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, s.lastUsed.Load())) < pingInterval {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+			if _, err := s.Call(ctx, "server.ping", nil); err != nil {
+				s.client.WarningLogger.Printf("session %s: keepalive ping failed: %v\n", s.node.Host, err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package electrum
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestSession() *Session {
+	return &Session{
+		client:  discardClient(),
+		node:    &Node{Host: "test"},
+		pending: make(map[int]*pendingCall),
+		subs:    make(map[string]*subscription),
+	}
+}
+
+// TestDispatchRoutesScripthashNotification reproduces the real Electrum
+// wire protocol: a subscribe call with a single scripthash param, followed
+// by a notification carrying that same scripthash plus a fresh status.
+func TestDispatchRoutesScripthashNotification(t *testing.T) {
+	s := newTestSession()
+	ch := make(chan Notification, 1)
+	s.subs[subscriptionKey("blockchain.scripthash.subscribe", []string{"deadbeef"})] = &subscription{
+		method: "blockchain.scripthash.subscribe", params: []string{"deadbeef"}, ch: ch,
+	}
+
+	s.dispatch([]byte(`{"method":"blockchain.scripthash.subscribe","params":["deadbeef","newstatus"]}`))
+
+	select {
+	case n := <-ch:
+		if n.Method != "blockchain.scripthash.subscribe" {
+			t.Fatalf("unexpected method %q", n.Method)
+		}
+	default:
+		t.Fatal("expected the scripthash notification to be delivered")
+	}
+}
+
+// TestDispatchRoutesHeadersNotification covers subscriptions with no
+// identifying leading param, where the notification's own params carry only
+// fresh state (the new tip header) and must fall back to bare-method
+// routing.
+func TestDispatchRoutesHeadersNotification(t *testing.T) {
+	s := newTestSession()
+	ch := make(chan Notification, 1)
+	s.subs[subscriptionKey("blockchain.headers.subscribe", nil)] = &subscription{
+		method: "blockchain.headers.subscribe", params: nil, ch: ch,
+	}
+
+	s.dispatch([]byte(`{"method":"blockchain.headers.subscribe","params":[{"height":1,"hex":"00"}]}`))
+
+	select {
+	case n := <-ch:
+		if n.Method != "blockchain.headers.subscribe" {
+			t.Fatalf("unexpected method %q", n.Method)
+		}
+	default:
+		t.Fatal("expected the headers notification to be delivered")
+	}
+}
+
+// TestDispatchDropsUnsubscribedNotification guards against a false-positive
+// match: a notification for a scripthash nobody subscribed to must not be
+// delivered anywhere.
+func TestDispatchDropsUnsubscribedNotification(t *testing.T) {
+	s := newTestSession()
+	ch := make(chan Notification, 1)
+	s.subs[subscriptionKey("blockchain.scripthash.subscribe", []string{"deadbeef"})] = &subscription{
+		method: "blockchain.scripthash.subscribe", params: []string{"deadbeef"}, ch: ch,
+	}
+
+	s.dispatch([]byte(`{"method":"blockchain.scripthash.subscribe","params":["othersubscription","newstatus"]}`))
+
+	select {
+	case n := <-ch:
+		t.Fatalf("unexpected notification delivered: %+v", n)
+	default:
+	}
+}
+
+func TestDispatchRoutesResponseToPendingCall(t *testing.T) {
+	s := newTestSession()
+	call := &pendingCall{result: make(chan json.RawMessage, 1), err: make(chan error, 1)}
+	s.pending[7] = call
+
+	s.dispatch([]byte(`{"id":7,"result":"ok"}`))
+
+	select {
+	case res := <-call.result:
+		if string(res) != `"ok"` {
+			t.Fatalf("unexpected result %s", res)
+		}
+	case err := <-call.err:
+		t.Fatalf("unexpected error %v", err)
+	default:
+		t.Fatal("expected the response to complete the pending call")
+	}
+}
+
+// pipeDialer returns a Client.WithDialer hook that hands out one side of a
+// net.Pipe per dial and pushes the other side onto conns, so a test can
+// play upstream node without a real socket.
+func pipeDialer(conns chan<- net.Conn) Dialer {
+	return func(_, _ string) (net.Conn, error) {
+		client, server := net.Pipe()
+		conns <- server
+		return client, nil
+	}
+}
+
+// readRequestLine reads and decodes one newline-delimited sessionRequest
+// off conn, as a fake upstream node would.
+func readRequestLine(conn net.Conn) (sessionRequest, error) {
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return sessionRequest{}, fmt.Errorf("could not read request line: %v", err)
+	}
+	var req sessionRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return sessionRequest{}, fmt.Errorf("could not decode request line %q: %v", line, err)
+	}
+	return req, nil
+}
+
+func TestSessionCallRoundTrips(t *testing.T) {
+	conns := make(chan net.Conn, 4)
+	c := discardClient().WithDialer(pipeDialer(conns))
+
+	s, err := NewSession(c, &Node{Host: "test"}, time.Second)
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	defer s.Close()
+
+	server := <-conns
+	defer server.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		req, err := readRequestLine(server)
+		if err != nil {
+			errs <- err
+			return
+		}
+		_, err = fmt.Fprintf(server, `{"id":%d,"result":"pong"}`+"\n", req.ID)
+		errs <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	res, err := s.Call(ctx, "server.ping", nil)
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if string(res) != `"pong"` {
+		t.Fatalf("got result %s, want %q", res, "pong")
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("fake peer goroutine failed: %v", err)
+	}
+}
+
+// TestSessionReconnectResubscribes reproduces the bug a reconnect used to
+// leave behind: a lost connection must not permanently silence a live
+// subscription. It drives a Session through an actual reconnect (closing
+// the upstream side of the first pipe to force a read error) and checks
+// that the subscribe call is replayed against the new connection, with
+// notifications on it still reaching the original channel.
+func TestSessionReconnectResubscribes(t *testing.T) {
+	conns := make(chan net.Conn, 4)
+	c := discardClient().WithDialer(pipeDialer(conns))
+
+	s, err := NewSession(c, &Node{Host: "test"}, time.Second)
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	defer s.Close()
+
+	server1 := <-conns
+	errs := make(chan error, 2)
+	go func() {
+		req, err := readRequestLine(server1)
+		if err != nil {
+			errs <- err
+			return
+		}
+		_, err = fmt.Fprintf(server1, `{"id":%d,"result":"subscribed"}`+"\n", req.ID)
+		errs <- err
+	}()
+
+	subCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, notifications, err := s.Subscribe(subCtx, "blockchain.headers.subscribe", nil)
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("fake peer goroutine failed: %v", err)
+	}
+
+	// Sever the connection; readLoop should notice, mark the session
+	// unhealthy, and start reconnecting.
+	server1.Close()
+
+	server2 := <-conns
+	defer server2.Close()
+
+	resubscribed := make(chan struct{})
+	go func() {
+		req, err := readRequestLine(server2)
+		if err != nil {
+			errs <- err
+			return
+		}
+		if req.Method != "blockchain.headers.subscribe" {
+			errs <- fmt.Errorf("resubscribe used method %q, want blockchain.headers.subscribe", req.Method)
+			return
+		}
+		if _, err := fmt.Fprintf(server2, `{"id":%d,"result":"subscribed"}`+"\n", req.ID); err != nil {
+			errs <- err
+			return
+		}
+		close(resubscribed)
+		_, err = fmt.Fprint(server2, `{"method":"blockchain.headers.subscribe","params":[{"height":2,"hex":"01"}]}`+"\n")
+		errs <- err
+	}()
+
+	select {
+	case <-resubscribed:
+	case err := <-errs:
+		t.Fatalf("fake peer goroutine failed: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconnect never replayed the subscribe call against the new connection")
+	}
+
+	select {
+	case n := <-notifications:
+		if n.Method != "blockchain.headers.subscribe" {
+			t.Fatalf("unexpected method %q", n.Method)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification sent on the reconnected connection never reached the subscriber")
+	}
+}
@@ -0,0 +1,186 @@
+package electrum
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	socksVersion5         = 0x05
+	socksAuthNone         = 0x00
+	socksAuthUserPass     = 0x02
+	socksAuthNoAcceptable = 0xFF
+	socksUserPassVersion  = 0x01
+	socksCmdConnect       = 0x01
+	socksAddrTypeIPv4     = 0x01
+	socksAddrTypeDomain   = 0x03
+	socksAddrTypeIPv6     = 0x04
+)
+
+// SOCKSAuth carries optional username/password credentials for the SOCKS5
+// subnegotiation defined in RFC 1929. Tor treats distinct credentials as a
+// request for a fresh circuit, so passing a unique SOCKSAuth per node can be
+// used to request stream isolation.
+type SOCKSAuth struct {
+	Username string
+	Password string
+}
+
+// DialOnion opens a TCP connection to addr (host:port) through the SOCKS5
+// proxy at proxyAddr, typically a local Tor daemon listening on
+// 127.0.0.1:9050. It performs the RFC 1928 handshake, including the
+// username/password auth subnegotiation when auth is non-nil, and honors
+// timeout for both the proxy dial and the handshake.
+func DialOnion(proxyAddr, addr string, auth *SOCKSAuth, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.Dial("tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to SOCKS5 proxy %s: %v", proxyAddr, err)
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+		if err := conn.SetDeadline(deadline); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("could not set SOCKS5 handshake deadline for %s: %v", proxyAddr, err)
+		}
+	}
+	if err := socksHandshake(conn, addr, auth); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if !deadline.IsZero() {
+		if err := conn.SetDeadline(time.Time{}); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("could not clear SOCKS5 handshake deadline for %s: %v", proxyAddr, err)
+		}
+	}
+	return conn, nil
+}
+
+// socksHandshake performs method selection, optional auth, and the CONNECT
+// request against an already-dialed connection to the proxy.
+func socksHandshake(conn net.Conn, addr string, auth *SOCKSAuth) error {
+	method := byte(socksAuthNone)
+	if auth != nil {
+		method = socksAuthUserPass
+	}
+	if _, err := conn.Write([]byte{socksVersion5, 0x01, method}); err != nil {
+		return fmt.Errorf("socks5: could not write method selection: %v", err)
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("socks5: could not read method selection reply: %v", err)
+	}
+	if reply[0] != socksVersion5 {
+		return fmt.Errorf("socks5: proxy replied with unsupported version %d", reply[0])
+	}
+	switch reply[1] {
+	case method:
+		if method == socksAuthUserPass {
+			if err := socksAuthenticate(conn, auth); err != nil {
+				return err
+			}
+		}
+	case socksAuthNoAcceptable:
+		return errors.New("socks5: proxy rejected all offered auth methods")
+	default:
+		return fmt.Errorf("socks5: proxy selected unrequested auth method %d", reply[1])
+	}
+	return socksConnect(conn, addr)
+}
+
+func socksAuthenticate(conn net.Conn, auth *SOCKSAuth) error {
+	if len(auth.Username) > 255 || len(auth.Password) > 255 {
+		return errors.New("socks5: username and password must each be at most 255 bytes")
+	}
+	req := make([]byte, 0, 3+len(auth.Username)+len(auth.Password))
+	req = append(req, socksUserPassVersion, byte(len(auth.Username)))
+	req = append(req, auth.Username...)
+	req = append(req, byte(len(auth.Password)))
+	req = append(req, auth.Password...)
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks5: could not write auth subnegotiation: %v", err)
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("socks5: could not read auth subnegotiation reply: %v", err)
+	}
+	if reply[1] != 0x00 {
+		return errors.New("socks5: username/password authentication rejected by proxy")
+	}
+	return nil
+}
+
+func socksConnect(conn net.Conn, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("socks5: invalid target address %s: %v", addr, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("socks5: invalid target port in %s: %v", addr, err)
+	}
+	req := []byte{socksVersion5, socksCmdConnect, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(req, socksAddrTypeIPv4)
+			req = append(req, ip4...)
+		} else {
+			req = append(req, socksAddrTypeIPv6)
+			req = append(req, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return errors.New("socks5: domain name too long")
+		}
+		req = append(req, socksAddrTypeDomain, byte(len(host)))
+		req = append(req, host...)
+	}
+	portBytes := make([]byte, 2)
+	binary.BigEndian.PutUint16(portBytes, uint16(port))
+	req = append(req, portBytes...)
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks5: could not write connect request: %v", err)
+	}
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return fmt.Errorf("socks5: could not read connect reply: %v", err)
+	}
+	if head[0] != socksVersion5 {
+		return fmt.Errorf("socks5: proxy replied with unsupported version %d", head[0])
+	}
+	if head[1] != 0x00 {
+		return fmt.Errorf("socks5: proxy refused connection to %s: reply code %d", addr, head[1])
+	}
+	return socksDiscardBoundAddr(conn, head[3])
+}
+
+// socksDiscardBoundAddr reads and discards the BND.ADDR/BND.PORT fields of a
+// CONNECT reply; electrumrelay has no use for the address the proxy bound.
+func socksDiscardBoundAddr(conn net.Conn, addrType byte) error {
+	var n int
+	switch addrType {
+	case socksAddrTypeIPv4:
+		n = net.IPv4len
+	case socksAddrTypeIPv6:
+		n = net.IPv6len
+	case socksAddrTypeDomain:
+		lenBuf := make([]byte, 1)
+		if _, err := io.ReadFull(conn, lenBuf); err != nil {
+			return fmt.Errorf("socks5: could not read bound domain length: %v", err)
+		}
+		n = int(lenBuf[0])
+	default:
+		return fmt.Errorf("socks5: unknown bound address type %d in connect reply", addrType)
+	}
+	if _, err := io.ReadFull(conn, make([]byte, n+2)); err != nil {
+		return fmt.Errorf("socks5: could not read bound address: %v", err)
+	}
+	return nil
+}
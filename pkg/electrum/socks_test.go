@@ -0,0 +1,177 @@
+package electrum
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeSOCKSProxy accepts a single connection and runs the RFC 1928
+// handshake as a server would: it selects username/password auth when
+// wantAuth is non-nil (no auth otherwise) and checks the credentials the
+// client sends against wantAuth. It replies with a successful CONNECT
+// response so the caller's DialOnion returns a usable conn.
+func fakeSOCKSProxy(t *testing.T, wantAuth *SOCKSAuth) (addr string, done <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not start fake proxy listener: %v", err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- serveFakeSOCKSConn(ln, wantAuth)
+	}()
+	return ln.Addr().String(), errCh
+}
+
+func serveFakeSOCKSConn(ln net.Listener, wantAuth *SOCKSAuth) error {
+	defer ln.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	methodHeader := make([]byte, 2)
+	if _, err := io.ReadFull(conn, methodHeader); err != nil {
+		return err
+	}
+	methods := make([]byte, methodHeader[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return err
+	}
+
+	selected := byte(socksAuthNone)
+	if wantAuth != nil {
+		selected = socksAuthUserPass
+	}
+	if _, err := conn.Write([]byte{socksVersion5, selected}); err != nil {
+		return err
+	}
+
+	if wantAuth != nil {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return err
+		}
+		user := make([]byte, header[1])
+		if _, err := io.ReadFull(conn, user); err != nil {
+			return err
+		}
+		passLen := make([]byte, 1)
+		if _, err := io.ReadFull(conn, passLen); err != nil {
+			return err
+		}
+		pass := make([]byte, passLen[0])
+		if _, err := io.ReadFull(conn, pass); err != nil {
+			return err
+		}
+		status := byte(0x00)
+		if string(user) != wantAuth.Username || string(pass) != wantAuth.Password {
+			status = 0x01
+		}
+		if _, err := conn.Write([]byte{socksUserPassVersion, status}); err != nil {
+			return err
+		}
+		if status != 0x00 {
+			return nil
+		}
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	switch head[3] {
+	case socksAddrTypeDomain:
+		lenBuf := make([]byte, 1)
+		if _, err := io.ReadFull(conn, lenBuf); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, make([]byte, int(lenBuf[0])+2)); err != nil {
+			return err
+		}
+	case socksAddrTypeIPv4:
+		if _, err := io.ReadFull(conn, make([]byte, net.IPv4len+2)); err != nil {
+			return err
+		}
+	case socksAddrTypeIPv6:
+		if _, err := io.ReadFull(conn, make([]byte, net.IPv6len+2)); err != nil {
+			return err
+		}
+	}
+
+	reply := []byte{socksVersion5, 0x00, 0x00, socksAddrTypeIPv4, 0, 0, 0, 0, 0, 0}
+	_, err = conn.Write(reply)
+	return err
+}
+
+func TestDialOnionNoAuth(t *testing.T) {
+	proxyAddr, done := fakeSOCKSProxy(t, nil)
+
+	conn, err := DialOnion(proxyAddr, "example.onion:50001", nil, 2*time.Second)
+	if err != nil {
+		t.Fatalf("DialOnion failed: %v", err)
+	}
+	defer conn.Close()
+
+	if err := <-done; err != nil {
+		t.Fatalf("fake proxy reported an error: %v", err)
+	}
+}
+
+func TestDialOnionWithAuth(t *testing.T) {
+	auth := &SOCKSAuth{Username: "alice", Password: "hunter2"}
+	proxyAddr, done := fakeSOCKSProxy(t, auth)
+
+	conn, err := DialOnion(proxyAddr, "example.onion:50001", auth, 2*time.Second)
+	if err != nil {
+		t.Fatalf("DialOnion failed: %v", err)
+	}
+	defer conn.Close()
+
+	if err := <-done; err != nil {
+		t.Fatalf("fake proxy reported an error: %v", err)
+	}
+}
+
+func TestDialOnionRejectsMismatchedCredentials(t *testing.T) {
+	serverAuth := &SOCKSAuth{Username: "alice", Password: "hunter2"}
+	proxyAddr, done := fakeSOCKSProxy(t, serverAuth)
+
+	_, err := DialOnion(proxyAddr, "example.onion:50001", &SOCKSAuth{Username: "mallory", Password: "wrong"}, 2*time.Second)
+	if err == nil {
+		t.Fatal("expected DialOnion to fail with mismatched credentials")
+	}
+	<-done
+}
+
+func TestDialOnionIPv4Target(t *testing.T) {
+	proxyAddr, done := fakeSOCKSProxy(t, nil)
+
+	conn, err := DialOnion(proxyAddr, "127.0.0.1:50001", nil, 2*time.Second)
+	if err != nil {
+		t.Fatalf("DialOnion failed: %v", err)
+	}
+	defer conn.Close()
+
+	if err := <-done; err != nil {
+		t.Fatalf("fake proxy reported an error: %v", err)
+	}
+}
+
+func TestSocksConnectRejectsOverlongDomain(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	over := make([]byte, 256)
+	for i := range over {
+		over[i] = 'a'
+	}
+
+	if err := socksConnect(client, string(over)+":50001"); err == nil {
+		t.Fatal("expected socksConnect to reject an over-long domain name")
+	}
+}